@@ -0,0 +1,39 @@
+package main
+
+// config holds every setting the application needs at startup, populated
+// from command-line flags in main(). It's kept as a single plain struct so
+// application can embed one value rather than threading a dozen individual
+// settings through.
+type config struct {
+	port int
+	env  string
+
+	db struct {
+		dsn string
+	}
+
+	// PasswordEncryptionKey is the base key internal/data.NewModels derives
+	// the password_hash and TOTP secret AEAD keys from. Left empty, NewModels
+	// falls back to crypto.DefaultEncryptionKey, which is fine for local
+	// development but must be set to a real secret in production.
+	PasswordEncryptionKey string
+
+	// ReverseProxy configures the trusted-header authentication mode used by
+	// reverseProxyAuthenticate. It's left zero-valued (empty Whitelist) by
+	// default, which disables the mode entirely, since an empty whitelist
+	// never matches any peer.
+	ReverseProxy struct {
+		// UserHeader is the header the proxy sets to the authenticated
+		// username. Defaults to "Remote-User" when empty.
+		UserHeader string
+
+		// EmailHeader is an optional header carrying the user's email,
+		// for proxies that don't want the username itself used as the
+		// email. Falls back to UserHeader's value when empty.
+		EmailHeader string
+
+		// Whitelist is the set of CIDR ranges a request's peer address must
+		// fall inside for its trusted headers to be honored.
+		Whitelist []string
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net"
+	"net/http"
+)
+
+// reverseProxyAuthenticate implements delegated authentication for requests
+// that have already been authenticated by a trusted upstream proxy. When the
+// request's RemoteAddr matches cfg.ReverseProxy.Whitelist and the configured
+// user header is present, it looks up (or auto-provisions) the corresponding
+// data.User and sets it in the request context exactly like the bearer-token
+// path, short-circuiting token authentication entirely. Any request that
+// doesn't match - wrong peer, missing header - is passed through unchanged
+// so the normal bearer-token middleware further down the chain still runs.
+func (app *application) reverseProxyAuthenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		cfg := app.config.ReverseProxy
+
+		userHeader := cfg.UserHeader
+		if userHeader == "" {
+			userHeader = "Remote-User"
+		}
+
+		remoteUser := r.Header.Get(userHeader)
+		if remoteUser == "" || !app.reverseProxyPeerTrusted(r, cfg.Whitelist) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		email := remoteUser
+		if cfg.EmailHeader != "" {
+			if h := r.Header.Get(cfg.EmailHeader); h != "" {
+				email = h
+			}
+		}
+
+		user, err := app.models.Users.GetOrProvisionExternal(remoteUser, email)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		r = app.contextSetUser(r, user)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reverseProxyPeerTrusted reports whether the request's peer address falls
+// inside one of the configured CIDR ranges. A missing or malformed
+// RemoteAddr, or an empty whitelist, is never trusted.
+func (app *application) reverseProxyPeerTrusted(r *http.Request, whitelist []string) bool {
+	if len(whitelist) == 0 {
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, cidr := range whitelist {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReverseProxyPeerTrusted(t *testing.T) {
+	app := &application{}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		whitelist  []string
+		want       bool
+	}{
+		{"in whitelisted range", "10.0.0.5:1234", []string{"10.0.0.0/8"}, true},
+		{"outside whitelisted range", "203.0.113.9:1234", []string{"10.0.0.0/8"}, false},
+		{"empty whitelist trusts nothing", "10.0.0.5:1234", nil, false},
+		{"malformed remote addr", "not-an-addr", []string{"10.0.0.0/8"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+
+			got := app.reverseProxyPeerTrusted(r, tt.whitelist)
+			if got != tt.want {
+				t.Fatalf("reverseProxyPeerTrusted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestReverseProxyAuthenticate_UntrustedPeerIgnoresHeaders asserts that a
+// spoofed trusted-user header from a peer outside the whitelist is never
+// honored: the request must pass through to next unauthenticated, rather
+// than reaching the (here absent) Users model at all.
+func TestReverseProxyAuthenticate_UntrustedPeerIgnoresHeaders(t *testing.T) {
+	app := &application{}
+	app.config.ReverseProxy.Whitelist = []string{"10.0.0.0/8"}
+	app.config.ReverseProxy.UserHeader = "Remote-User"
+
+	var nextCalled bool
+	var panicked bool
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nextCalled = true
+		defer func() {
+			if recover() != nil {
+				panicked = true
+			}
+		}()
+		app.contextGetUser(r)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "203.0.113.9:1234"
+	r.Header.Set("Remote-User", "attacker")
+
+	w := httptest.NewRecorder()
+	app.reverseProxyAuthenticate(next).ServeHTTP(w, r)
+
+	if !nextCalled {
+		t.Fatalf("next handler was never called")
+	}
+	if !panicked {
+		t.Fatalf("contextGetUser() did not panic, meaning a spoofed header from an untrusted peer set a user in context")
+	}
+}
+
+// TestReverseProxyAuthenticate_MissingHeaderPassesThrough asserts a request
+// from a trusted peer with no trusted-user header is left alone, too - the
+// middleware must not treat "trusted peer" alone as sufficient.
+func TestReverseProxyAuthenticate_MissingHeaderPassesThrough(t *testing.T) {
+	app := &application{}
+	app.config.ReverseProxy.Whitelist = []string{"10.0.0.0/8"}
+	app.config.ReverseProxy.UserHeader = "Remote-User"
+
+	var panicked bool
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if recover() != nil {
+				panicked = true
+			}
+		}()
+		app.contextGetUser(r)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.5:1234"
+
+	w := httptest.NewRecorder()
+	app.reverseProxyAuthenticate(next).ServeHTTP(w, r)
+
+	if !panicked {
+		t.Fatalf("contextGetUser() did not panic, meaning a user was set despite no trusted-user header being present")
+	}
+}
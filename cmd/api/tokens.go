@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"natenine.backend.API/internal/data"
+	"natenine.backend.API/internal/password"
+	"natenine.backend.API/internal/validator"
+)
+
+func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateEmail(v, input.Email)
+	data.ValidatePassowrdPlaintext(v, input.Password)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	// The stored hash verified, but it was written by an older hasher. Upgrade
+	// it to the current version now, while we still have the plaintext, so
+	// the user is transparently migrated without a forced password reset.
+	if user.Password.NeedsRehash(password.CurrentVersion) {
+		err = user.Password.Set(input.Password)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.models.Users.Update(user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// A password-only check is never enough for a user who has enrolled a
+	// second factor: issue a short-lived totp_required token instead, which
+	// the step-up endpoint below exchanges for a real authentication token.
+	if user.RequireTOTP() {
+		stepUpToken, err := app.models.Tokens.New(user.ID, 10*time.Minute, data.ScopeTOTPRequired)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"totp_required_token": stepUpToken}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createTOTPStepUpTokenHandler redeems a totp_required token plus either a
+// valid RFC 6238 code or an unused recovery code for a real authentication
+// token, completing the login that createAuthenticationTokenHandler put on
+// hold. The recovery code path exists so a user who has lost their
+// authenticator device isn't permanently locked out of their account.
+func (app *application) createTOTPStepUpTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TOTPRequiredToken string `json:"totp_required_token"`
+		Code              string `json:"code"`
+		RecoveryCode      string `json:"recovery_code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateTokenPlaintext(v, input.TOTPRequiredToken)
+	v.Check(input.Code != "" || input.RecoveryCode != "", "code", "must provide either a code or a recovery_code")
+	if input.Code != "" {
+		data.ValidateTOTPCode(v, input.Code)
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeTOTPRequired, input.TOTPRequiredToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if input.RecoveryCode != "" {
+		err = app.models.TOTP.RedeemRecoveryCode(user.ID, input.RecoveryCode)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecoveryCodeInvalid), errors.Is(err, data.ErrTOTPNotEnrolled):
+				app.invalidCredentialsResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	} else {
+		ok, err := app.verifyTOTPCode(user.ID, input.Code)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !ok {
+			app.invalidCredentialsResponse(w, r)
+			return
+		}
+	}
+
+	// The totp_required token has served its purpose; burn it so it can't be
+	// replayed against this endpoint again.
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeTOTPRequired, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"net/http"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+
+	"natenine.backend.API/internal/data"
+	"natenine.backend.API/internal/totp"
+	"natenine.backend.API/internal/validator"
+)
+
+const totpIssuer = "BackendGoAPI"
+
+// enrollTOTPHandler starts enrollment for the authenticated user: it
+// generates a new secret and a fresh set of recovery codes, stores them
+// unconfirmed, and returns the otpauth URI, a QR code PNG for the user's
+// authenticator app to scan, and the recovery code plaintexts. The recovery
+// codes are hashed before storage and are never retrievable again after this
+// response, so the caller must show them to the user now.
+func (app *application) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	recoveryCodes, recoveryCodesHash, err := data.GenerateRecoveryCodes()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.TOTP.Insert(&data.TOTP{
+		UserID:            user.ID,
+		SecretCiphertext:  secret,
+		RecoveryCodesHash: recoveryCodesHash,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	uri := totp.URI(totpIssuer, user.Email, secret)
+
+	var qrBuf bytes.Buffer
+	qr, err := qrcode.New(uri, qrcode.Medium)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if err := png.Encode(&qrBuf, qr.Image(256)); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{
+		"otpauth_uri":    uri,
+		"qr_code_png":    qrBuf.Bytes(),
+		"recovery_codes": recoveryCodes,
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// confirmTOTPHandler completes enrollment once the user proves they can
+// generate a valid code from the secret they just scanned.
+func (app *application) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateTOTPCode(v, input.Code)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ok, err := app.verifyTOTPCode(user.ID, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	err = app.models.TOTP.Confirm(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "totp enrollment confirmed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// verifyTOTPCode checks code against the stored secret for userID, returning
+// (false, nil) for an unenrolled user rather than an error, since "not
+// enrolled" is an expected state at the login step-up decision point.
+func (app *application) verifyTOTPCode(userID int64, code string) (bool, error) {
+	record, err := app.models.TOTP.GetByUserID(userID)
+	if err != nil {
+		if errors.Is(err, data.ErrTOTPNotEnrolled) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return totp.Validate(code, record.SecretCiphertext, time.Now()), nil
+}
@@ -1,26 +1,59 @@
 package data
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
 	"strings"
 
 	"natenine.backend.API/internal/validator"
 )
 
+// PaginationMode selects how a Filters value should be applied to a query.
+type PaginationMode int
+
+const (
+	// PaginationOffset pages with Page/PageSize and a LIMIT/OFFSET, the
+	// original behaviour. offset() grows linearly expensive on large
+	// tables and results can shift under concurrent inserts.
+	PaginationOffset PaginationMode = iota
+	// PaginationKeyset pages with a Cursor instead, giving constant-time
+	// page jumps and stable results regardless of concurrent writes.
+	PaginationKeyset
+)
+
+// maxCursorLen bounds the client-supplied cursor so a garbage or hostile
+// value can't be used to smuggle an oversized payload through query params.
+const maxCursorLen = 512
+
 type Filters struct {
 	Page         int
 	PageSize     int
 	Sort         string
 	SortSafeList []string
+	Cursor       string
+	Mode         PaginationMode
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
-	v.Check(f.Page > 0, "page", "must be greater than zero")
-	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be less than 100")
-
 	v.Check(validator.PermittedValue(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+
+	switch f.Mode {
+	case PaginationKeyset:
+		v.Check(f.Page == 0, "page", "must not be provided together with a cursor")
+		v.Check(len(f.Cursor) <= maxCursorLen, "cursor", "must not be more than 512 bytes long")
+	default:
+		v.Check(f.Cursor == "", "cursor", "must not be provided without cursor pagination")
+		v.Check(f.Page > 0, "page", "must be greater than zero")
+		v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
+	}
 }
 
 // Check that the client-provided Sort field matches one of the entries in our safelist
@@ -54,12 +87,124 @@ func (f Filters) offset() int {
 	return (f.Page - 1) * f.PageSize
 }
 
+// cursorRow is the pair of values a keyset cursor resumes from: the sort
+// column's value on the last row of the previous page, and that row's id as
+// a tiebreaker for rows that share a sort value.
+type cursorRow struct {
+	SortValue any
+	ID        int64
+}
+
+type cursorPayload struct {
+	V   int    `json:"v"`
+	Col string `json:"col"`
+	Val any    `json:"val"`
+	ID  int64  `json:"id"`
+	Dir string `json:"dir"`
+}
+
+// cursorSigningKey authenticates cursors so a client can't edit one to page
+// into rows its filters shouldn't see. DefaultCursorSigningKey is used until
+// an operator configures one, mirroring crypto.DefaultEncryptionKey.
+var DefaultCursorSigningKey = []byte("BackendGoAPI-default-cursor-signing-key-do-not-rely-on-this")
+
+var cursorSigningKey = DefaultCursorSigningKey
+
+// SetCursorSigningKey overrides the key used to sign and verify cursors.
+// Call it once at startup from config, before any cursor is issued or read.
+func SetCursorSigningKey(key []byte) {
+	cursorSigningKey = key
+}
+
+// encodeCursor signs and encodes row as the opaque string returned to
+// clients as next_cursor/prev_cursor.
+func encodeCursor(row cursorRow, col, dir string) (string, error) {
+	body, err := json.Marshal(cursorPayload{V: 1, Col: col, Val: row.SortValue, ID: row.ID, Dir: dir})
+	if err != nil {
+		return "", err
+	}
+
+	sig := signCursor(body)
+
+	blob := make([]byte, 0, len(body)+len(sig))
+	blob = append(blob, body...)
+	blob = append(blob, sig...)
+
+	return base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(blob), nil
+}
+
+// decodeCursor reverses encodeCursor, rejecting a cursor whose signature
+// doesn't match (tampered or signed with a since-rotated key) or whose sort
+// column doesn't match col (stale cursor reused after the client changed
+// sort order).
+func decodeCursor(cursor, col string) (cursorRow, error) {
+	blob, err := base64.URLEncoding.WithPadding(base64.NoPadding).DecodeString(cursor)
+	if err != nil {
+		return cursorRow{}, fmt.Errorf("invalid cursor encoding: %w", err)
+	}
+
+	sigLen := sha256.Size
+	if len(blob) <= sigLen {
+		return cursorRow{}, errors.New("invalid cursor")
+	}
+
+	body, sig := blob[:len(blob)-sigLen], blob[len(blob)-sigLen:]
+	if subtle.ConstantTimeCompare(sig, signCursor(body)) != 1 {
+		return cursorRow{}, errors.New("invalid cursor signature")
+	}
+
+	var payload cursorPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return cursorRow{}, fmt.Errorf("invalid cursor payload: %w", err)
+	}
+
+	if payload.V != 1 {
+		return cursorRow{}, fmt.Errorf("unsupported cursor version %d", payload.V)
+	}
+	if payload.Col != col {
+		return cursorRow{}, errors.New("cursor does not match current sort column")
+	}
+
+	return cursorRow{SortValue: payload.Val, ID: payload.ID}, nil
+}
+
+func signCursor(body []byte) []byte {
+	mac := hmac.New(sha256.New, cursorSigningKey)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// keysetPredicate builds the WHERE fragment and its args that resume a
+// keyset page after f.Cursor, comparing the tuple (column, id) against the
+// cursor so rows with a duplicate sort value are still ordered and paged
+// deterministically by id. It returns an empty fragment for the first page
+// (no cursor yet).
+func (f Filters) keysetPredicate(column, direction string) (sqlFragment string, args []any, err error) {
+	if f.Cursor == "" {
+		return "", nil, nil
+	}
+
+	row, err := decodeCursor(f.Cursor, column)
+	if err != nil {
+		return "", nil, err
+	}
+
+	op := ">"
+	if direction == "DESC" {
+		op = "<"
+	}
+
+	return fmt.Sprintf("WHERE (%s, id) %s ($1, $2)", column, op), []any{row.SortValue, row.ID}, nil
+}
+
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
 }
 
 func calculateMetadata(totalRecords, page, pagesize int) Metadata {
@@ -75,3 +220,35 @@ func calculateMetadata(totalRecords, page, pagesize int) Metadata {
 		TotalRecords: totalRecords,
 	}
 }
+
+// calculateKeysetMetadata builds a Metadata for a keyset page. rows must be
+// the page's results in sort order, over-fetched by one (LIMIT page_size+1)
+// so the presence of that extra row signals there's a next page; the caller
+// trims it back to pageSize before returning results to the client.
+func calculateKeysetMetadata(rows []cursorRow, pageSize int, column, direction string) (Metadata, error) {
+	meta := Metadata{PageSize: pageSize}
+
+	if len(rows) == 0 {
+		return meta, nil
+	}
+
+	last := rows[len(rows)-1]
+	if len(rows) > pageSize {
+		last = rows[pageSize-1]
+
+		cursor, err := encodeCursor(last, column, direction)
+		if err != nil {
+			return Metadata{}, err
+		}
+		meta.NextCursor = cursor
+	}
+
+	first := rows[0]
+	prevCursor, err := encodeCursor(first, column, direction)
+	if err != nil {
+		return Metadata{}, err
+	}
+	meta.PrevCursor = prevCursor
+
+	return meta, nil
+}
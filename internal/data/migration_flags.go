@@ -0,0 +1,45 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// MigrationFlagModel records one-time data migrations that have already run,
+// backed by a migration_flags(name TEXT PRIMARY KEY, applied_at TIMESTAMP)
+// table, so a migration command like "encrypt-passwords" is safe to invoke
+// more than once.
+type MigrationFlagModel struct {
+	DB *sql.DB
+}
+
+func (m MigrationFlagModel) IsApplied(name string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM migration_flags WHERE name = $1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var applied bool
+	err := m.DB.QueryRowContext(ctx, query, name).Scan(&applied)
+	if err != nil {
+		return false, err
+	}
+	return applied, nil
+}
+
+func (m MigrationFlagModel) MarkApplied(name string) error {
+	query := `
+			INSERT INTO migration_flags (name, applied_at)
+			VALUES ($1, $2)
+			ON CONFLICT (name) DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, name, time.Now())
+	return err
+}
+
+var ErrMigrationAlreadyApplied = errors.New("migration already applied")
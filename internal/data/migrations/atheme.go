@@ -0,0 +1,92 @@
+package migrations
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"natenine.backend.API/internal/password"
+)
+
+// Atheme is an Importer for services.db-style flat files produced by
+// Atheme IRC services: "MU <uuid> <name> <hash> <email> <registered_ts> ..."
+// account lines, with "MN <uuid> <name> ..." lines grouping additional
+// registered nicks under the same account.
+type Atheme struct{}
+
+func (Atheme) Import(ctx context.Context, r io.Reader) (<-chan ImportedUser, <-chan error) {
+	out := make(chan ImportedUser)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(out)
+		defer close(errc)
+
+		users := make(map[string]*ImportedUser)
+		var order []string
+
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 0 {
+				continue
+			}
+
+			switch fields[0] {
+			case "MU":
+				if len(fields) < 6 {
+					continue
+				}
+				uuid := fields[1]
+				registeredTS, _ := strconv.ParseInt(fields[5], 10, 64)
+
+				users[uuid] = &ImportedUser{
+					Name:            fields[2],
+					Email:           fields[4],
+					PasswordHash:    []byte(fields[3]),
+					PasswordVersion: athemeHashVersion(fields[3]),
+					RegisteredAt:    time.Unix(registeredTS, 0),
+				}
+				order = append(order, uuid)
+			case "MN":
+				if len(fields) < 3 {
+					continue
+				}
+				if u, ok := users[fields[1]]; ok {
+					u.AdditionalNames = append(u.AdditionalNames, fields[2])
+				}
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			errc <- err
+			return
+		}
+
+		for _, uuid := range order {
+			select {
+			case out <- *users[uuid]:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return out, errc
+}
+
+// athemeHashVersion maps an Atheme crypto-module hash to the closest
+// password.Version we can still verify with. Atheme's bcrypt module writes
+// the same "$2..." format bcrypt.CompareHashAndPassword already accepts
+// regardless of cost, so those hashes keep working immediately; anything
+// else (crypt3 MD5/DES, SHA) has no Hasher registered and needs a reset.
+func athemeHashVersion(hash string) int {
+	if strings.HasPrefix(hash, "$2") {
+		return password.VersionBcryptCost12
+	}
+	return password.VersionUnsupportedLegacy
+}
@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"natenine.backend.API/internal/password"
+)
+
+// Htpasswd is an Importer for Apache/nginx htpasswd files. Each non-blank,
+// non-comment line is "username:hash"; the email is left empty since
+// htpasswd has no concept of one, and the caller must be prepared to handle
+// rows with no email (the "./api import" subcommand synthesizes a
+// placeholder from the username; UserModel.BulkInsert does not check).
+type Htpasswd struct{}
+
+func (Htpasswd) Import(ctx context.Context, r io.Reader) (<-chan ImportedUser, <-chan error) {
+	out := make(chan ImportedUser)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(out)
+		defer close(errc)
+
+		scanner := bufio.NewScanner(r)
+		lineNum := 0
+
+		for scanner.Scan() {
+			lineNum++
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			name, hash, found := strings.Cut(line, ":")
+			if !found {
+				errc <- fmt.Errorf("htpasswd: malformed line %d", lineNum)
+				return
+			}
+
+			user := ImportedUser{
+				Name:            name,
+				PasswordHash:    []byte(hash),
+				PasswordVersion: htpasswdHashVersion(hash),
+			}
+
+			select {
+			case out <- user:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			errc <- err
+		}
+	}()
+
+	return out, errc
+}
+
+// htpasswdHashVersion maps an htpasswd hash format to the closest
+// password.Version we can still verify with. bcrypt ("$2...") verifies
+// as-is; APR1 ("$apr1$") and plain SHA ("{SHA}") have no registered Hasher.
+func htpasswdHashVersion(hash string) int {
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		return password.VersionBcryptCost12
+	default:
+		return password.VersionUnsupportedLegacy
+	}
+}
@@ -0,0 +1,47 @@
+// Package migrations provides importers that migrate an existing user base
+// from an external auth store into this API's users table, preserving the
+// original password hash so operators don't have to force a reset on every
+// account. See UserModel.BulkInsert for how imported users are persisted.
+package migrations
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ImportedUser is the common shape every Importer produces, regardless of
+// source format. PasswordHash and PasswordVersion are carried through
+// verbatim so the versioned password.Hasher registry can still verify (or,
+// for formats we can't map to a known Hasher, refuse and require a reset)
+// on first login.
+type ImportedUser struct {
+	Name            string
+	Email           string
+	PasswordHash    []byte
+	PasswordVersion int
+	AdditionalNames []string
+	RegisteredAt    time.Time
+}
+
+// Importer streams users out of an external export format. Both channels
+// are closed when the reader is exhausted; a send on the error channel
+// means the import aborted and out will receive no further values.
+type Importer interface {
+	Import(ctx context.Context, r io.Reader) (<-chan ImportedUser, <-chan error)
+}
+
+// Report summarizes the outcome of running an Importer's output through
+// UserModel.BulkInsert, the shape returned as JSON by the "./api import"
+// subcommand.
+type Report struct {
+	Imported int               `json:"imported"`
+	Skipped  int               `json:"skipped"`
+	Failed   int               `json:"failed"`
+	Errors   []SkippedOrFailed `json:"errors,omitempty"`
+}
+
+type SkippedOrFailed struct {
+	Email  string `json:"email"`
+	Reason string `json:"reason"`
+}
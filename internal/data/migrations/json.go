@@ -0,0 +1,79 @@
+package migrations
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"natenine.backend.API/internal/password"
+)
+
+// JSONUser is the documented schema for the JSON importer: a JSON array of
+// these objects. password_algorithm is one of "bcrypt" or "argon2id"; any
+// other value (or an empty one) is imported as VersionUnsupportedLegacy.
+type JSONUser struct {
+	Name              string    `json:"name"`
+	Email             string    `json:"email"`
+	PasswordHash      string    `json:"password_hash"`
+	PasswordAlgorithm string    `json:"password_algorithm"`
+	AdditionalNames   []string  `json:"additional_names"`
+	RegisteredAt      time.Time `json:"registered_at"`
+}
+
+// JSON is an Importer for a JSON array of JSONUser objects.
+type JSON struct{}
+
+func (JSON) Import(ctx context.Context, r io.Reader) (<-chan ImportedUser, <-chan error) {
+	out := make(chan ImportedUser)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(out)
+		defer close(errc)
+
+		dec := json.NewDecoder(r)
+
+		if _, err := dec.Token(); err != nil { // consume the opening '['
+			errc <- err
+			return
+		}
+
+		for dec.More() {
+			var u JSONUser
+			if err := dec.Decode(&u); err != nil {
+				errc <- err
+				return
+			}
+
+			user := ImportedUser{
+				Name:            u.Name,
+				Email:           u.Email,
+				PasswordHash:    []byte(u.PasswordHash),
+				PasswordVersion: jsonHashVersion(u.PasswordAlgorithm),
+				AdditionalNames: u.AdditionalNames,
+				RegisteredAt:    u.RegisteredAt,
+			}
+
+			select {
+			case out <- user:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return out, errc
+}
+
+func jsonHashVersion(algorithm string) int {
+	switch algorithm {
+	case "bcrypt":
+		return password.VersionBcryptCost12
+	case "argon2id":
+		return password.VersionArgon2id
+	default:
+		return password.VersionUnsupportedLegacy
+	}
+}
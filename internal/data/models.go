@@ -0,0 +1,55 @@
+package data
+
+import (
+	"database/sql"
+
+	"natenine.backend.API/internal/crypto"
+)
+
+// Models collects every model this API exposes behind a single value so
+// cmd/api only has to thread one thing (app.models) through handlers,
+// instead of a DB handle and a model per table.
+type Models struct {
+	Users          UserModel
+	Tokens         TokenModel
+	TOTP           TOTPModel
+	MigrationFlags MigrationFlagModel
+}
+
+// NewModels wires every model to db, deriving the AEAD keys that
+// UserModel and TOTPModel use to seal/open their encrypted columns from
+// encryptionKey. Passing a nil or empty encryptionKey falls back to
+// crypto.DefaultEncryptionKey, so installs that haven't configured an
+// encryption key yet still read and write consistently.
+func NewModels(db *sql.DB, encryptionKey []byte) (Models, error) {
+	if len(encryptionKey) == 0 {
+		encryptionKey = crypto.DefaultEncryptionKey
+	}
+
+	passwordKey, err := crypto.DeriveKey(encryptionKey, "password_hash")
+	if err != nil {
+		return Models{}, err
+	}
+
+	totpKey, err := crypto.DeriveKey(encryptionKey, "totp_secret")
+	if err != nil {
+		return Models{}, err
+	}
+
+	passwordEncryptor, err := crypto.NewEncryptor(passwordKey)
+	if err != nil {
+		return Models{}, err
+	}
+
+	totpEncryptor, err := crypto.NewEncryptor(totpKey)
+	if err != nil {
+		return Models{}, err
+	}
+
+	return Models{
+		Users:          UserModel{DB: db, Encryptor: passwordEncryptor},
+		Tokens:         TokenModel{DB: db},
+		TOTP:           TOTPModel{DB: db, Encryptor: totpEncryptor},
+		MigrationFlags: MigrationFlagModel{DB: db},
+	}, nil
+}
@@ -0,0 +1,227 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+	"natenine.backend.API/internal/crypto"
+	"natenine.backend.API/internal/validator"
+)
+
+var totpCodeRX = regexp.MustCompile(`^[0-9]{6}$`)
+
+var ErrTOTPNotEnrolled = errors.New("totp not enrolled")
+
+// ErrRecoveryCodeInvalid is returned by RedeemRecoveryCode when code doesn't
+// match any unused recovery code on file for the user.
+var ErrRecoveryCodeInvalid = errors.New("recovery code invalid or already used")
+
+// recoveryCodeCount is how many one-time recovery codes are issued per
+// enrollment, enough that losing a few doesn't lock the user out while
+// still being a short, printable list.
+const recoveryCodeCount = 10
+
+type TOTP struct {
+	UserID            int64
+	SecretCiphertext  []byte
+	ConfirmedAt       *time.Time
+	RecoveryCodesHash [][]byte
+	Version           int
+}
+
+// Confirmed reports whether enrollment has completed a successful code
+// verification. Rows created by the enroll step but never confirmed must
+// not be treated as an active second factor.
+func (t *TOTP) Confirmed() bool {
+	return t.ConfirmedAt != nil
+}
+
+func ValidateTOTPCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(validator.Matches(code, totpCodeRX), "code", "must be a 6-digit code")
+}
+
+type TOTPModel struct {
+	DB        *sql.DB
+	Encryptor *crypto.Encryptor
+}
+
+// Insert stores a newly-enrolled, unconfirmed TOTP row for a user. Any prior
+// row for that user is replaced, since a user may restart enrollment (e.g.
+// after losing the QR code) before ever confirming.
+func (m TOTPModel) Insert(t *TOTP) error {
+	query := `
+			INSERT INTO user_totp (user_id, secret_ciphertext, recovery_codes_hash, version)
+			VALUES ($1, $2, $3, 1)
+			ON CONFLICT (user_id) DO UPDATE
+			SET secret_ciphertext = EXCLUDED.secret_ciphertext,
+				recovery_codes_hash = EXCLUDED.recovery_codes_hash,
+				confirmed_at = NULL,
+				version = user_totp.version + 1
+			RETURNING version`
+
+	encryptedSecret, err := m.Encryptor.Seal(t.SecretCiphertext)
+	if err != nil {
+		return err
+	}
+
+	args := []any{t.UserID, encryptedSecret, pq.ByteaArray(t.RecoveryCodesHash)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&t.Version)
+}
+
+func (m TOTPModel) GetByUserID(userID int64) (*TOTP, error) {
+	query := `
+			SELECT user_id, secret_ciphertext, confirmed_at, recovery_codes_hash, version
+			FROM user_totp
+			WHERE user_id = $1`
+
+	var t TOTP
+	var recoveryCodes pq.ByteaArray
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&t.UserID,
+		&t.SecretCiphertext,
+		&t.ConfirmedAt,
+		&recoveryCodes,
+		&t.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrTOTPNotEnrolled
+		default:
+			return nil, err
+		}
+	}
+
+	t.SecretCiphertext, err = m.Encryptor.Open(t.SecretCiphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	t.RecoveryCodesHash = [][]byte(recoveryCodes)
+	return &t, nil
+}
+
+// Confirm marks enrollment complete once the user has proven possession of
+// the secret by submitting a valid code.
+func (m TOTPModel) Confirm(userID int64) error {
+	query := `
+			UPDATE user_totp
+			SET confirmed_at = $1, version = version + 1
+			WHERE user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, time.Now(), userID)
+	return err
+}
+
+func (m TOTPModel) Delete(userID int64) error {
+	query := `DELETE FROM user_totp WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// HashRecoveryCode reduces a plaintext recovery code to the form stored in
+// recovery_codes_hash, the same way token hashes are derived in
+// UserModel.GetForToken.
+func HashRecoveryCode(code string) []byte {
+	hash := sha256.Sum256([]byte(code))
+	return hash[:]
+}
+
+// GenerateRecoveryCodes returns a fresh batch of recoveryCodeCount one-time
+// recovery code plaintexts, alongside the hashes TOTPModel.Insert persists.
+// Like Token, the plaintexts themselves are never stored anywhere - the
+// caller must return them to the user exactly once, at enrollment time.
+func GenerateRecoveryCodes() (plaintext []string, hashes [][]byte, err error) {
+	plaintext = make([]string, recoveryCodeCount)
+	hashes = make([][]byte, recoveryCodeCount)
+
+	for i := range plaintext {
+		randomBytes := make([]byte, 5)
+		if _, err := rand.Read(randomBytes); err != nil {
+			return nil, nil, err
+		}
+
+		code := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+		plaintext[i] = code
+		hashes[i] = HashRecoveryCode(code)
+	}
+
+	return plaintext, hashes, nil
+}
+
+// RedeemRecoveryCode consumes the one stored recovery code matching code, if
+// any, so it can never be replayed. It's the fallback login step-up path for
+// a user who has lost their authenticator device.
+func (m TOTPModel) RedeemRecoveryCode(userID int64, code string) error {
+	t, err := m.GetByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	target := HashRecoveryCode(code)
+
+	matched := false
+	remaining := make([][]byte, 0, len(t.RecoveryCodesHash))
+	for _, hash := range t.RecoveryCodesHash {
+		if !matched && subtle.ConstantTimeCompare(hash, target) == 1 {
+			matched = true
+			continue
+		}
+		remaining = append(remaining, hash)
+	}
+
+	if !matched {
+		return ErrRecoveryCodeInvalid
+	}
+
+	// Guard the write with the version read above, the same optimistic-
+	// concurrency check UserModel.Update uses: without it, two concurrent
+	// redemptions of the same code could both read the code as present and
+	// both report success, burning only one of the two writes.
+	query := `
+			UPDATE user_totp
+			SET recovery_codes_hash = $1, version = version + 1
+			WHERE user_id = $2 AND version = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, pq.ByteaArray(remaining), userID, t.Version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecoveryCodeInvalid
+	}
+
+	return nil
+}
@@ -7,24 +7,30 @@ import (
 	"errors"
 	"time"
 
+	"github.com/lib/pq"
+	"natenine.backend.API/internal/crypto"
 	"natenine.backend.API/internal/password"
 	"natenine.backend.API/internal/validator"
 )
 
 var (
+	ErrRecordNotFound = errors.New("record not found")
+	ErrEditConflict   = errors.New("edit conflict")
 	ErrDuplicateEmail = errors.New("duplicate email")
 )
 
 var AnonymousUser = &User{}
 
 type User struct {
-	ID        int64             `json:"id"`
-	CreatedAt time.Time         `json:"created_at"`
-	Name      string            `json:"name"`
-	Email     string            `json:"email"`
-	Password  password.Password `json:"-"`
-	Activated bool              `json:"activated"`
-	Version   int               `json:"-"`
+	ID              int64             `json:"id"`
+	CreatedAt       time.Time         `json:"created_at"`
+	Name            string            `json:"name"`
+	Email           string            `json:"email"`
+	Password        password.Password `json:"-"`
+	Activated       bool              `json:"activated"`
+	TOTPEnabled     bool              `json:"-"`
+	AdditionalNames []string          `json:"additional_names,omitempty"`
+	Version         int               `json:"-"`
 }
 
 // check if a user instance is AnonymousUser
@@ -32,6 +38,19 @@ func (u *User) IsAnonumous() bool {
 	return u == AnonymousUser
 }
 
+// HasTOTP reports whether the user has a confirmed TOTP enrollment.
+func (u *User) HasTOTP() bool {
+	return u.TOTPEnabled
+}
+
+// RequireTOTP reports whether a login for this user must be stepped up with
+// a TOTP code before a full authentication token is issued. Today that's
+// simply whether they've enrolled, but it's kept distinct from HasTOTP so an
+// org-wide enforcement policy can hook in later without changing call sites.
+func (u *User) RequireTOTP() bool {
+	return u.HasTOTP()
+}
+
 func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(email != "", "email", "must be provided")
 	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
@@ -62,25 +81,33 @@ func ValidateUser(v *validator.Validator, user *User) {
 	}
 }
 
-// Create a UserModel struct which wraps the connection pool.
+// Create a UserModel struct which wraps the connection pool. Encryptor seals
+// password_hash on write and opens it on read, so the column never holds a
+// usable hash in plaintext at rest.
 type UserModel struct {
-	DB *sql.DB
+	DB        *sql.DB
+	Encryptor *crypto.Encryptor
 }
 
 func (m UserModel) Insert(user *User) error {
 	query := `
-			INSERT INTO users (name, email, password_hash, activated)
-			VALUES ($1, $2, $3, $4)
+			INSERT INTO users (name, email, password_hash, password_version, activated)
+			VALUES ($1, $2, $3, $4, $5)
 			RETURNING id, created_at, version`
 
-	args := []any{user.Name, user.Email, user.Password.Hash, user.Activated}
+	encryptedHash, err := m.Encryptor.Seal(user.Password.Hash)
+	if err != nil {
+		return err
+	}
+
+	args := []any{user.Name, user.Email, encryptedHash, user.Password.Version, user.Activated}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	// If the table already contains a record with this email address, then when we try
 	// to perform the insert there will be a violation of the UNIQUE "users_email_key"
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
@@ -92,11 +119,69 @@ func (m UserModel) Insert(user *User) error {
 	return nil
 }
 
+// BulkInsertFailure records why BulkInsert couldn't insert one row, so a
+// caller can report it instead of losing the whole batch's progress.
+type BulkInsertFailure struct {
+	Email  string
+	Reason string
+}
+
+// BulkInsert inserts many users, skipping (not erroring on) any whose email
+// already exists, for use by the importers in internal/data/migrations. Each
+// row is inserted independently rather than in one all-or-nothing
+// transaction, so a single bad row (a constraint violation, say) is reported
+// in failed and the rest of the batch still goes in. It returns how many
+// rows were actually inserted and how many were skipped as duplicates.
+func (m UserModel) BulkInsert(users []*User) (inserted, skipped int, failed []BulkInsertFailure, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	stmt, err := m.DB.PrepareContext(ctx, `
+			INSERT INTO users (name, email, password_hash, password_version, activated, additional_names)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (email) DO NOTHING`)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	defer stmt.Close()
+
+	for _, user := range users {
+		encryptedHash, err := m.Encryptor.Seal(user.Password.Hash)
+		if err != nil {
+			failed = append(failed, BulkInsertFailure{Email: user.Email, Reason: err.Error()})
+			continue
+		}
+
+		result, err := stmt.ExecContext(ctx, user.Name, user.Email, encryptedHash,
+			user.Password.Version, user.Activated, pq.Array(user.AdditionalNames))
+		if err != nil {
+			failed = append(failed, BulkInsertFailure{Email: user.Email, Reason: err.Error()})
+			continue
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			failed = append(failed, BulkInsertFailure{Email: user.Email, Reason: err.Error()})
+			continue
+		}
+
+		if rowsAffected == 0 {
+			skipped++
+		} else {
+			inserted++
+		}
+	}
+
+	return inserted, skipped, failed, nil
+}
+
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-			SELECT id, created_at, name, email, password_hash, activated, version
+			SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.password_version,
+				users.activated, users.version, user_totp.confirmed_at IS NOT NULL
 			FROM users
-			WHERE email = $1`
+			LEFT JOIN user_totp ON user_totp.user_id = users.id
+			WHERE users.email = $1`
 	var user User
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -108,8 +193,10 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Name,
 		&user.Email,
 		&user.Password.Hash,
+		&user.Password.Version,
 		&user.Activated,
 		&user.Version,
+		&user.TOTPEnabled,
 	)
 
 	if err != nil {
@@ -120,20 +207,36 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 			return nil, err
 		}
 	}
+
+	// Rows written before the encrypt-passwords migration ran still hold a
+	// plaintext bcrypt/argon2id hash; only envelope-shaped rows need opening.
+	if crypto.IsEnvelope(user.Password.Hash) {
+		user.Password.Hash, err = m.Encryptor.Open(user.Password.Hash)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &user, nil
 }
 
 func (m UserModel) Update(user *User) error {
 	query := `
 			UPDATE users
-			SET name = $1, email= $2, password_hash=$3, activated=$4, version=version + 1
-			WHERE id = $5 AND version=$6
+			SET name = $1, email= $2, password_hash=$3, password_version=$4, activated=$5, version=version + 1
+			WHERE id = $6 AND version=$7
 			RETURNING version`
 
+	encryptedHash, err := m.Encryptor.Seal(user.Password.Hash)
+	if err != nil {
+		return err
+	}
+
 	args := []any{
 		user.Name,
 		user.Email,
-		user.Password.Hash,
+		encryptedHash,
+		user.Password.Version,
 		user.Activated,
 		user.ID,
 		user.Version,
@@ -142,7 +245,7 @@ func (m UserModel) Update(user *User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "user_email_key"`:
@@ -163,10 +266,13 @@ func (m UserModel) GetForToken(tokenScope, tokenPlainText string) (*User, error)
 	tokenHash := sha256.Sum256([]byte(tokenPlainText))
 
 	query := `
-			SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+			SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.password_version,
+				users.activated, users.version, user_totp.confirmed_at IS NOT NULL
 			FROM users
 			INNER JOIN tokens
 			ON users.id = tokens.user_id
+			LEFT JOIN user_totp
+			ON user_totp.user_id = users.id
 			WHERE tokens.hash = $1
 			AND tokens.scope = $2
 			AND tokens.expiry > $3`
@@ -185,8 +291,10 @@ func (m UserModel) GetForToken(tokenScope, tokenPlainText string) (*User, error)
 		&user.Name,
 		&user.Email,
 		&user.Password.Hash,
+		&user.Password.Version,
 		&user.Activated,
 		&user.Version,
+		&user.TOTPEnabled,
 	)
 
 	if err != nil {
@@ -198,5 +306,53 @@ func (m UserModel) GetForToken(tokenScope, tokenPlainText string) (*User, error)
 		}
 	}
 
+	if crypto.IsEnvelope(user.Password.Hash) {
+		user.Password.Hash, err = m.Encryptor.Open(user.Password.Hash)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &user, nil
 }
+
+// GetOrProvisionExternal looks up an existing user by email for the
+// reverse-proxy auth middleware, auto-provisioning one with an unusable
+// VersionExternal password hash on first sight. An existing record - local
+// password or otherwise - is always returned as-is: this must never touch
+// Password on a row that already exists, or a local-password user could be
+// silently locked out of their own password by a misconfigured proxy.
+func (m UserModel) GetOrProvisionExternal(name, email string) (*User, error) {
+	user, err := m.GetByEmail(email)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, ErrRecordNotFound) {
+		return nil, err
+	}
+
+	hash, version, err := password.NewExternalHash()
+	if err != nil {
+		return nil, err
+	}
+
+	user = &User{
+		Name:      name,
+		Email:     email,
+		Activated: true,
+		Password:  password.Password{Hash: hash, Version: version},
+	}
+
+	if err := m.Insert(user); err != nil {
+		// Another request may have auto-provisioned (or registered) this
+		// same email between our GetByEmail miss and this Insert; treat
+		// that the same as having found it the first time, rather than
+		// failing a login that should have just succeeded.
+		if errors.Is(err, ErrDuplicateEmail) {
+			return m.GetByEmail(email)
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
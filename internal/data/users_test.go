@@ -0,0 +1,128 @@
+package data
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+
+	"natenine.backend.API/internal/crypto"
+	"natenine.backend.API/internal/password"
+)
+
+func newTestUserModel(t *testing.T) (UserModel, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("sqlmock.New() returned error: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	key, err := crypto.DeriveKey(crypto.DefaultEncryptionKey, "test")
+	if err != nil {
+		t.Fatalf("crypto.DeriveKey() returned error: %v", err)
+	}
+	encryptor, err := crypto.NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("crypto.NewEncryptor() returned error: %v", err)
+	}
+
+	return UserModel{DB: db, Encryptor: encryptor}, mock
+}
+
+const getByEmailQuery = `
+			SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.password_version,
+				users.activated, users.version, user_totp.confirmed_at IS NOT NULL
+			FROM users
+			LEFT JOIN user_totp ON user_totp.user_id = users.id
+			WHERE users.email = $1`
+
+const insertQuery = `
+			INSERT INTO users (name, email, password_hash, password_version, activated)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, created_at, version`
+
+// TestGetOrProvisionExternal_AutoProvisions covers the first-sight path: no
+// existing user for the email, so one is created with an unusable
+// VersionExternal password.
+func TestGetOrProvisionExternal_AutoProvisions(t *testing.T) {
+	m, mock := newTestUserModel(t)
+
+	mock.ExpectQuery(getByEmailQuery).
+		WithArgs("new.user@example.com").
+		WillReturnError(sql.ErrNoRows)
+
+	mock.ExpectQuery(insertQuery).
+		WithArgs("New User", "new.user@example.com", sqlmock.AnyArg(), password.VersionExternal, true).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "version"}).
+			AddRow(1, time.Now(), 1))
+
+	user, err := m.GetOrProvisionExternal("New User", "new.user@example.com")
+	if err != nil {
+		t.Fatalf("GetOrProvisionExternal() returned error: %v", err)
+	}
+
+	if user.Password.Version != password.VersionExternal {
+		t.Fatalf("Password.Version = %d, want %d", user.Password.Version, password.VersionExternal)
+	}
+	if match, _ := user.Password.Matches("literally anything"); match {
+		t.Fatalf("Password.Matches() = true for an auto-provisioned external user, want always false")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+// TestGetOrProvisionExternal_DoesNotOverwriteExistingUser covers the case
+// where the email already belongs to a user with a real local password: the
+// proxy must never touch that user's credentials, or a misconfigured
+// whitelist could lock them out of their own account.
+func TestGetOrProvisionExternal_DoesNotOverwriteExistingUser(t *testing.T) {
+	m, mock := newTestUserModel(t)
+
+	var p password.Password
+	if err := p.Set("correct horse battery staple"); err != nil {
+		t.Fatalf("Password.Set() returned error: %v", err)
+	}
+	sealedHash, err := m.Encryptor.Seal(p.Hash)
+	if err != nil {
+		t.Fatalf("Encryptor.Seal() returned error: %v", err)
+	}
+
+	mock.ExpectQuery(getByEmailQuery).
+		WithArgs("existing.user@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "created_at", "name", "email", "password_hash", "password_version",
+			"activated", "version", "totp_enabled",
+		}).AddRow(42, time.Now(), "Existing User", "existing.user@example.com", sealedHash, p.Version, true, 1, false))
+
+	user, err := m.GetOrProvisionExternal("Existing User", "existing.user@example.com")
+	if err != nil {
+		t.Fatalf("GetOrProvisionExternal() returned error: %v", err)
+	}
+
+	if user.ID != 42 {
+		t.Fatalf("ID = %d, want 42 (the existing row, not a freshly-inserted one)", user.ID)
+	}
+	if user.Password.Version != p.Version {
+		t.Fatalf("Password.Version = %d, want %d (existing local password left untouched)", user.Password.Version, p.Version)
+	}
+
+	match, err := user.Password.Matches("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("Password.Matches() returned error: %v", err)
+	}
+	if !match {
+		t.Fatalf("Password.Matches() = false, want true (existing local password must still verify)")
+	}
+
+	// No INSERT expectation was set up above; if GetOrProvisionExternal tried
+	// to run one anyway, ExpectationsWereMet would be satisfied but the extra
+	// call itself would error out against the mock's expectation queue.
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
@@ -1,38 +1,236 @@
 package password
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// base64RawEncoding is used (rather than the padded standard encoding) so
+// that encoded hashes match the conventional "$argon2id$..." format used by
+// the reference argon2 CLI and other language implementations.
+var base64RawEncoding = base64.RawStdEncoding
+
+// Password versions identify which Hasher produced (and therefore must verify)
+// a given hash. New versions are appended; existing values must never be
+// reassigned or reused, since they are persisted in the password_version
+// column.
+const (
+	VersionBcryptCost10 = 1
+	VersionBcryptCost12 = 2
+	VersionArgon2id     = 3
+
+	// VersionExternal marks a user whose credentials are verified entirely
+	// outside this application (see the reverse-proxy auth middleware). The
+	// stored hash is random filler, never a real password, so Compare must
+	// always report a mismatch: there is no plaintext that should ever log
+	// such an account in locally.
+	VersionExternal = 4
+
+	// VersionUnsupportedLegacy marks a hash imported from an external store
+	// (see internal/data/migrations) in a format we have no Hasher for, such
+	// as crypt(3) MD5 or SHA. There is deliberately no entry for it in
+	// hashers: Matches will refuse to verify it, and the account must go
+	// through a password reset before it can log in.
+	VersionUnsupportedLegacy = -1
+
+	// CurrentVersion is the version written by Set(). Bump this (and add a
+	// matching entry to hashers) to roll out a new default algorithm/cost.
+	CurrentVersion = VersionArgon2id
+)
+
+// ErrPasswordMismatch is returned by a Hasher's Compare method when the
+// supplied plaintext does not match the stored hash.
+var ErrPasswordMismatch = errors.New("password mismatch")
+
+// Hasher hashes and verifies plaintext passwords for a single algorithm and
+// parameter set. Each supported version has exactly one Hasher registered
+// for it in hashers below.
+type Hasher interface {
+	Hash(plaintext string) ([]byte, error)
+	Compare(hash []byte, plaintext string) error
+	Version() int
+}
+
+type bcryptHasher struct {
+	cost    int
+	version int
+}
+
+func (h bcryptHasher) Hash(plaintext string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(plaintext), h.cost)
+}
+
+func (h bcryptHasher) Compare(hash []byte, plaintext string) error {
+	err := bcrypt.CompareHashAndPassword(hash, []byte(plaintext))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (h bcryptHasher) Version() int {
+	return h.version
+}
+
+// argon2idHasher hashes with argon2id, encoding the salt and parameters
+// alongside the derived key so that Compare is self-describing even if the
+// tuning parameters change in a future version.
+type argon2idHasher struct {
+	version int
+	time    uint32
+	memory  uint32
+	threads uint8
+	keyLen  uint32
+	saltLen uint32
+}
+
+func (h argon2idHasher) Hash(plaintext string) ([]byte, error) {
+	salt := make([]byte, h.saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(plaintext), salt, h.time, h.memory, h.threads, h.keyLen)
+
+	encoded := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.memory, h.time, h.threads,
+		base64RawEncode(salt), base64RawEncode(key))
+
+	return []byte(encoded), nil
+}
+
+func (h argon2idHasher) Compare(hash []byte, plaintext string) error {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 {
+		return errors.New("password: malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return fmt.Errorf("password: malformed argon2id version: %w", err)
+	}
+
+	var memory uint32
+	var time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return fmt.Errorf("password: malformed argon2id params: %w", err)
+	}
+
+	salt, err := base64RawDecode(parts[4])
+	if err != nil {
+		return fmt.Errorf("password: malformed argon2id salt: %w", err)
+	}
+
+	wantKey, err := base64RawDecode(parts[5])
+	if err != nil {
+		return fmt.Errorf("password: malformed argon2id key: %w", err)
+	}
+
+	gotKey := argon2.IDKey([]byte(plaintext), salt, time, memory, threads, uint32(len(wantKey)))
+
+	if subtle.ConstantTimeCompare(wantKey, gotKey) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (h argon2idHasher) Version() int {
+	return h.version
+}
+
+// externalHasher backs VersionExternal. It never produces a hash anyone
+// actually authenticates with (see NewExternalHash); Compare rejects every
+// plaintext unconditionally so a stolen or guessed password can never
+// authenticate an externally-managed account.
+type externalHasher struct{}
+
+func (h externalHasher) Hash(plaintext string) ([]byte, error) {
+	return nil, errors.New("password: external accounts do not have a local password to hash")
+}
+
+func (h externalHasher) Compare(hash []byte, plaintext string) error {
+	return ErrPasswordMismatch
+}
+
+func (h externalHasher) Version() int {
+	return VersionExternal
+}
+
+// NewExternalHash returns a random, never-verifiable filler hash and the
+// VersionExternal version for provisioning a user whose credentials are
+// verified by a trusted reverse proxy rather than a local password.
+func NewExternalHash() ([]byte, int, error) {
+	filler := make([]byte, 32)
+	if _, err := rand.Read(filler); err != nil {
+		return nil, 0, err
+	}
+	return filler, VersionExternal, nil
+}
+
+// hashers maps every password version this binary knows how to verify to the
+// Hasher that produced it. Entries must never be removed, only added to, so
+// that users hashed under an older version can still log in and be
+// transparently upgraded via NeedsRehash.
+var hashers = map[int]Hasher{
+	VersionBcryptCost10: bcryptHasher{cost: 10, version: VersionBcryptCost10},
+	VersionBcryptCost12: bcryptHasher{cost: 12, version: VersionBcryptCost12},
+	VersionArgon2id: argon2idHasher{
+		version: VersionArgon2id,
+		time:    1,
+		memory:  64 * 1024,
+		threads: 4,
+		keyLen:  32,
+		saltLen: 16,
+	},
+	VersionExternal: externalHasher{},
+}
+
+func currentHasher() Hasher {
+	return hashers[CurrentVersion]
+}
+
 type Password struct {
 	PlainText *string
 	Hash      []byte
+	Version   int
 }
 
-// The Set() method calculates the bcrypt hash of a plaintext password, and stores both
-// the hash and the plaintext versions in the struct.
+// The Set() method hashes the plaintext password with the current Hasher,
+// and stores the hash, its version, and the plaintext version in the struct.
 func (p *Password) Set(plainTestPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plainTestPassword), 12)
+	hash, err := currentHasher().Hash(plainTestPassword)
 	if err != nil {
 		return err
 	}
 
 	p.PlainText = &plainTestPassword
 	p.Hash = hash
+	p.Version = CurrentVersion
 
 	return nil
 }
 
 // The Matches() method checks whether the provided plaintext password matches the
-// hashed password stored in the struct, returning true if it matches and false
-// otherwise.
+// hashed password stored in the struct, dispatching to the Hasher registered for
+// the stored Version so that hashes written by older versions keep verifying.
 func (p *Password) Matches(plainTestPassword string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword(p.Hash, []byte(plainTestPassword))
+	hasher, ok := hashers[p.Version]
+	if !ok {
+		return false, fmt.Errorf("password: no hasher registered for version %d", p.Version)
+	}
+
+	err := hasher.Compare(p.Hash, plainTestPassword)
 	if err != nil {
 		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		case errors.Is(err, ErrPasswordMismatch):
 			return false, nil
 		default:
 			return false, err
@@ -40,3 +238,17 @@ func (p *Password) Matches(plainTestPassword string) (bool, error) {
 	}
 	return true, nil
 }
+
+// NeedsRehash reports whether this password was hashed with a version other
+// than currentVersion and should be upgraded on the next successful login.
+func (p *Password) NeedsRehash(currentVersion int) bool {
+	return p.Version != currentVersion
+}
+
+func base64RawEncode(b []byte) string {
+	return base64RawEncoding.EncodeToString(b)
+}
+
+func base64RawDecode(s string) ([]byte, error) {
+	return base64RawEncoding.DecodeString(s)
+}
@@ -0,0 +1,107 @@
+package password
+
+import "testing"
+
+func TestMatchesAcrossVersions(t *testing.T) {
+	plaintext := "pa55word123"
+
+	tests := []struct {
+		name   string
+		hasher Hasher
+	}{
+		{"bcrypt cost 10", hashers[VersionBcryptCost10]},
+		{"bcrypt cost 12", hashers[VersionBcryptCost12]},
+		{"argon2id", hashers[VersionArgon2id]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := tt.hasher.Hash(plaintext)
+			if err != nil {
+				t.Fatalf("Hash() returned error: %v", err)
+			}
+
+			p := Password{Hash: hash, Version: tt.hasher.Version()}
+
+			match, err := p.Matches(plaintext)
+			if err != nil {
+				t.Fatalf("Matches() returned error: %v", err)
+			}
+			if !match {
+				t.Fatalf("Matches() = false, want true")
+			}
+
+			match, err = p.Matches("wrong-password")
+			if err != nil {
+				t.Fatalf("Matches() returned error: %v", err)
+			}
+			if match {
+				t.Fatalf("Matches() = true for wrong password, want false")
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	p := Password{Version: VersionBcryptCost10}
+
+	if !p.NeedsRehash(CurrentVersion) {
+		t.Fatalf("NeedsRehash() = false for stale version, want true")
+	}
+
+	p.Version = CurrentVersion
+	if p.NeedsRehash(CurrentVersion) {
+		t.Fatalf("NeedsRehash() = true for current version, want false")
+	}
+}
+
+// TestUpgradePath exercises the bcrypt-cost-10 -> bcrypt-cost-12 -> argon2id
+// progression a real login would walk as CurrentVersion is bumped over time,
+// verifying each stale hash still authenticates and is flagged for upgrade.
+func TestUpgradePath(t *testing.T) {
+	plaintext := "correct horse battery staple"
+
+	hash10, err := hashers[VersionBcryptCost10].Hash(plaintext)
+	if err != nil {
+		t.Fatalf("Hash() returned error: %v", err)
+	}
+	p := Password{Hash: hash10, Version: VersionBcryptCost10}
+
+	match, err := p.Matches(plaintext)
+	if err != nil || !match {
+		t.Fatalf("Matches() on bcrypt-10 hash = (%v, %v), want (true, nil)", match, err)
+	}
+	if !p.NeedsRehash(VersionBcryptCost12) {
+		t.Fatalf("NeedsRehash(bcrypt-12) = false for bcrypt-10 hash, want true")
+	}
+
+	hash12, err := hashers[VersionBcryptCost12].Hash(plaintext)
+	if err != nil {
+		t.Fatalf("Hash() returned error: %v", err)
+	}
+	p = Password{Hash: hash12, Version: VersionBcryptCost12}
+
+	match, err = p.Matches(plaintext)
+	if err != nil || !match {
+		t.Fatalf("Matches() on bcrypt-12 hash = (%v, %v), want (true, nil)", match, err)
+	}
+	if !p.NeedsRehash(VersionArgon2id) {
+		t.Fatalf("NeedsRehash(argon2id) = false for bcrypt-12 hash, want true")
+	}
+
+	err = p.Set(plaintext)
+	if err != nil {
+		t.Fatalf("Set() returned error: %v", err)
+	}
+	if p.Version != CurrentVersion {
+		t.Fatalf("Version after Set() = %d, want %d", p.Version, CurrentVersion)
+	}
+	if p.NeedsRehash(CurrentVersion) {
+		t.Fatalf("NeedsRehash() = true immediately after Set(), want false (no-op migration)")
+	}
+
+	match, err = p.Matches(plaintext)
+	if err != nil || !match {
+		t.Fatalf("Matches() after upgrade = (%v, %v), want (true, nil)", match, err)
+	}
+}
@@ -0,0 +1,89 @@
+// Package totp implements the RFC 6238 time-based one-time password
+// algorithm used for second-factor login. It knows nothing about how
+// secrets are stored or encrypted; internal/data/totp.go owns persistence.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	period    = 30 * time.Second
+	digits    = 6
+	secretLen = 20
+	// skew is the number of adjacent time steps (past and future) tolerated
+	// to absorb clock drift between client and server.
+	skew = 1
+)
+
+// GenerateSecret returns a new random shared secret suitable for TOTP
+// enrollment.
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, secretLen)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// URI builds the otpauth:// URI that authenticator apps scan (directly, or
+// rendered as a QR code) to import the secret.
+func URI(issuer, accountName string, secret []byte) string {
+	label := url.PathEscape(fmt.Sprintf("%s:%s", issuer, accountName))
+
+	v := url.Values{}
+	v.Set("secret", base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret))
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", strconv.Itoa(digits))
+	v.Set("period", strconv.Itoa(int(period.Seconds())))
+
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, v.Encode())
+}
+
+// Generate returns the 6-digit code for secret at time t.
+func Generate(secret []byte, t time.Time) string {
+	return generateAt(secret, counterAt(t, 0))
+}
+
+// Validate reports whether code matches secret at time t, allowing for
+// +/-skew time steps of clock drift.
+func Validate(code string, secret []byte, t time.Time) bool {
+	for step := -skew; step <= skew; step++ {
+		want := generateAt(secret, counterAt(t, step))
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func counterAt(t time.Time, stepOffset int) uint64 {
+	return uint64(t.Unix()/int64(period.Seconds())) + uint64(stepOffset)
+}
+
+func generateAt(secret []byte, counter uint64) string {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], counter)
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(buf[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	truncated := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	code := truncated % uint32(math.Pow10(digits))
+	return fmt.Sprintf("%0*d", digits, code)
+}